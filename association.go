@@ -0,0 +1,312 @@
+package openid
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestedAssocType and requestedSessionType are the only assoc_type and
+// session_type Associate ever sends in an associate request. An OP's reply
+// must echo back exactly this assoc_type and session_type; anything else is
+// treated as a downgrade, except an empty ("no-encryption") session_type
+// over https (see Client.Associate).
+const (
+	requestedAssocType   = "HMAC-SHA256"
+	requestedSessionType = "DH-SHA256"
+)
+
+// Default Diffie-Hellman modulus and generator for OpenID associate requests,
+// as specified in OpenID Authentication 2.0 section 8.1.1.
+var (
+	defaultDHModulus, _ = new(big.Int).SetString(
+		"155172898181473697471232257763715539915724801966915404479707795314057629"+
+			"378541917580651227423698188993727816152646631438561595825688188889951272"+
+			"158842675419950341258706556549803580104870537681476726513255747040765857"+
+			"479291291572334510643245094715007229621094194349783925984760375594985848"+
+			"253359305585439638443", 10)
+	defaultDHGenerator = big.NewInt(2)
+)
+
+// Association holds the shared secret negotiated with an OP via the
+// associate mode described in OpenID Authentication 2.0 section 8, allowing
+// Validate to check an assertion's signature locally instead of performing a
+// check_authentication round-trip.
+type Association struct {
+	Handle      string
+	MACKey      []byte
+	SessionType string
+	AssocType   string
+	Expires     time.Time
+}
+
+func (a *Association) expired() bool {
+	return !a.Expires.IsZero() && time.Now().After(a.Expires)
+}
+
+func (a *Association) hasher() func() hash.Hash {
+	if a.AssocType == "HMAC-SHA1" {
+		return sha1.New
+	}
+	return sha256.New
+}
+
+// AssociationStore caches Associations keyed by OP endpoint so that
+// Associate need not be called for every login. Implementations must be
+// safe for concurrent use.
+type AssociationStore interface {
+	Get(endpoint string) (*Association, bool)
+	Put(endpoint string, assoc *Association)
+}
+
+// memoryAssociationStore is the default AssociationStore, backed by a map
+// guarded by a mutex. It is suitable for a single-process RP; multi-process
+// deployments should plug in a Redis- or SQL-backed store instead.
+type memoryAssociationStore struct {
+	mu    sync.Mutex
+	assoc map[string]*Association
+}
+
+// NewMemoryAssociationStore returns an in-memory AssociationStore.
+func NewMemoryAssociationStore() AssociationStore {
+	return &memoryAssociationStore{assoc: make(map[string]*Association)}
+}
+
+func (s *memoryAssociationStore) Get(endpoint string) (*Association, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.assoc[endpoint]
+	if !ok || a.expired() {
+		return nil, false
+	}
+	return a, true
+}
+
+func (s *memoryAssociationStore) Put(endpoint string, assoc *Association) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assoc[endpoint] = assoc
+}
+
+// DefaultAssociationStore is consulted by Validate before falling back to
+// the stateless check_authentication mode. Replace it (or wrap Validate
+// yourself) to use a shared store across processes.
+var DefaultAssociationStore AssociationStore = NewMemoryAssociationStore()
+
+// Associate performs the Diffie-Hellman association handshake described in
+// OpenID Authentication 2.0 section 8.1 against endpoint using DefaultClient,
+// storing the resulting Association in DefaultClient's AssociationStore and
+// returning it.
+//
+// Associate uses context.Background(); to supply a deadline or
+// cancellation, or a custom *http.Client, use a Client of your own.
+func Associate(endpoint string) (*Association, error) {
+	return DefaultClient.Associate(context.Background(), endpoint)
+}
+
+// Associate performs the Diffie-Hellman association handshake described in
+// OpenID Authentication 2.0 section 8.1 against endpoint, storing the
+// resulting Association in c's AssociationStore and returning it.
+//
+// Only a DH-SHA256 session is ever requested. An OP response is rejected if
+// it doesn't echo back the requested assoc_type, or chooses a session_type
+// other than the one requested. The one exception is an empty
+// ("no-encryption") session_type, with the MAC key sent in cleartext: it is
+// accepted only when endpoint is https, since otherwise a network attacker
+// could force or observe it to recover the MAC key and forge signed
+// assertions.
+func (c *Client) Associate(ctx context.Context, endpoint string) (*Association, error) {
+	priv, err := rand.Int(rand.Reader, defaultDHModulus)
+	if err != nil {
+		return nil, err
+	}
+	pub := new(big.Int).Exp(defaultDHGenerator, priv, defaultDHModulus)
+
+	values := url.Values{
+		"openid.ns":                 {"http://specs.openid.net/auth/2.0"},
+		"openid.mode":               {"associate"},
+		"openid.assoc_type":         {requestedAssocType},
+		"openid.session_type":       {requestedSessionType},
+		"openid.dh_modulus":         {base64.StdEncoding.EncodeToString(btwoc(defaultDHModulus))},
+		"openid.dh_gen":             {base64.StdEncoding.EncodeToString(btwoc(defaultDHGenerator))},
+		"openid.dh_consumer_public": {base64.StdEncoding.EncodeToString(btwoc(pub))},
+	}
+
+	req, err := c.newRequest(ctx, "POST", endpoint, bytes.NewBufferString(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := c.readLimited(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	kv := keyValueForm(string(body))
+
+	if kv["error"] != "" {
+		return nil, errors.New("openid: associate failed: " + kv["error"])
+	}
+
+	assocType := kv["assoc_type"]
+	if assocType != requestedAssocType {
+		return nil, errors.New("openid: server returned unexpected assoc_type " + assocType)
+	}
+	sessionType := kv["session_type"]
+
+	var macKey []byte
+	switch sessionType {
+	case requestedSessionType: // "DH-SHA256"
+		serverPubBytes, err := base64.StdEncoding.DecodeString(kv["dh_server_public"])
+		if err != nil {
+			return nil, err
+		}
+		serverPub := new(big.Int).SetBytes(serverPubBytes)
+		shared := new(big.Int).Exp(serverPub, priv, defaultDHModulus)
+		digest := sha256.Sum256(btwoc(shared))
+
+		encMacKey, err := base64.StdEncoding.DecodeString(kv["enc_mac_key"])
+		if err != nil {
+			return nil, err
+		}
+		macKey = xor(digest[:], encMacKey)
+	case "":
+		// no-encryption session: mac_key is sent directly, so this is only
+		// safe to accept over https (OpenID Authentication 2.0 section
+		// 8.2.1).
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "https" {
+			return nil, errors.New("openid: refusing no-encryption association with " + endpoint + ": not https")
+		}
+		macKey, err = base64.StdEncoding.DecodeString(kv["mac_key"])
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("openid: server returned unrecognized session_type " + sessionType)
+	}
+
+	expiresIn, _ := strconv.Atoi(kv["expires_in"])
+	a := &Association{
+		Handle:      kv["assoc_handle"],
+		MACKey:      macKey,
+		AssocType:   assocType,
+		SessionType: sessionType,
+		Expires:     time.Now().Add(time.Duration(expiresIn) * time.Second),
+	}
+	c.associationStore().Put(endpoint, a)
+	return a, nil
+}
+
+// requiredSignedFields are the openid.* assertion fields that must be
+// listed in openid.signed whenever they're present in the response, per
+// OpenID Authentication 2.0 sections 10.1 and 11.2. Without this, an
+// attacker holding one legitimately-signed assertion from a shared OP
+// endpoint (Yahoo/AOL/myOpenID-style, one endpoint for many users) could
+// drop claimed_id from openid.signed and substitute a different user's
+// identifier - the MAC still verifies, since the substituted field was
+// never part of the signed buffer.
+var requiredSignedFields = []string{
+	"op_endpoint",
+	"return_to",
+	"response_nonce",
+	"assoc_handle",
+	"claimed_id",
+	"identity",
+}
+
+// verifyFieldsSigned reports whether every field in requiredSignedFields
+// that is present (non-empty) in values, and every non-empty
+// openid.<alias>.* field belonging to one of
+// extensions, is listed in openid.signed. It must be checked before
+// trusting anything in values, in both the local-verification and
+// check_authentication paths: otherwise an attacker can ride unsigned
+// core or extension fields (forged ax/sreg attribute values, for example)
+// alongside an assertion whose signed fields genuinely check out.
+func verifyFieldsSigned(values url.Values, extensions []Extension) bool {
+	signed := make(map[string]bool)
+	for _, field := range strings.Split(values.Get("openid.signed"), ",") {
+		signed[field] = true
+	}
+
+	for _, field := range requiredSignedFields {
+		if values.Get("openid."+field) != "" && !signed[field] {
+			return false
+		}
+	}
+
+	for _, ext := range extensions {
+		prefix := "openid." + ext.Alias() + "."
+		for key, vals := range values {
+			if !strings.HasPrefix(key, prefix) || len(vals) == 0 || vals[0] == "" {
+				continue
+			}
+			if !signed[strings.TrimPrefix(key, "openid.")] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// verifySignature checks openid.sig against the fields named in
+// openid.signed, per OpenID Authentication 2.0 section 6, using assoc's MAC
+// key. It does not itself check assoc_handle freshness, or that
+// requiredSignedFields are actually present in openid.signed - callers
+// must check verifyFieldsSigned first.
+func (a *Association) verifySignature(values url.Values) bool {
+	signed := strings.Split(values.Get("openid.signed"), ",")
+	var buf bytes.Buffer
+	for _, field := range signed {
+		buf.WriteString(field)
+		buf.WriteByte(':')
+		buf.WriteString(values.Get("openid." + field))
+		buf.WriteByte('\n')
+	}
+
+	mac := hmac.New(a.hasher(), a.MACKey)
+	mac.Write(buf.Bytes())
+	expected := mac.Sum(nil)
+
+	sig, err := base64.StdEncoding.DecodeString(values.Get("openid.sig"))
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, sig)
+}
+
+func xor(a, b []byte) []byte {
+	o := make([]byte, len(b))
+	for i := range o {
+		o[i] = b[i] ^ a[i%len(a)]
+	}
+	return o
+}
+
+func btwoc(i *big.Int) []byte {
+	b := i.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
@@ -0,0 +1,163 @@
+package openid
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// fakeExtension is a minimal Extension used to exercise
+// verifyFieldsSigned's handling of extension fields without depending on
+// the ax or sreg subpackages.
+type fakeExtension struct{}
+
+func (fakeExtension) NamespaceURI() string { return "urn:fake" }
+func (fakeExtension) Alias() string        { return "fake" }
+func (fakeExtension) AddRequest(v url.Values) {}
+func (fakeExtension) ParseResponse(v url.Values) (interface{}, error) {
+	return nil, nil
+}
+
+func TestVerifyFieldsSignedRequiresCoreFields(t *testing.T) {
+	values := url.Values{
+		"openid.claimed_id": {"https://victim.example/"},
+		"openid.signed":     {"return_to"},
+	}
+	if verifyFieldsSigned(values, nil) {
+		t.Error("verifyFieldsSigned accepted a present, unsigned claimed_id")
+	}
+}
+
+func TestVerifyFieldsSignedRequiresExtensionFields(t *testing.T) {
+	values := url.Values{
+		"openid.fake.value": {"forged"},
+		"openid.signed":     {"return_to"},
+	}
+	if verifyFieldsSigned(values, []Extension{fakeExtension{}}) {
+		t.Error("verifyFieldsSigned accepted a present, unsigned extension field")
+	}
+}
+
+func TestVerifyFieldsSignedAcceptsFullySignedAssertion(t *testing.T) {
+	values := url.Values{
+		"openid.claimed_id": {"https://user.example/"},
+		"openid.fake.value": {"legit"},
+		"openid.signed":     {"claimed_id,fake.value"},
+	}
+	if !verifyFieldsSigned(values, []Extension{fakeExtension{}}) {
+		t.Error("verifyFieldsSigned rejected an assertion with every present field signed")
+	}
+}
+
+func associateHandler(t *testing.T, kv map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range kv {
+			fmt.Fprintf(w, "%s:%s\n", k, v)
+		}
+	}
+}
+
+func TestAssociateRejectsNoEncryptionOverHTTP(t *testing.T) {
+	srv := httptest.NewServer(associateHandler(t, map[string]string{
+		"assoc_handle": "h1",
+		"assoc_type":   requestedAssocType,
+		"session_type": "",
+		"mac_key":      base64.StdEncoding.EncodeToString([]byte("0123456789012345678901234567890")),
+	}))
+	defer srv.Close()
+
+	c := &Client{AllowPrivateNetworks: true}
+	if _, err := c.Associate(context.Background(), srv.URL); err == nil {
+		t.Error("Associate accepted a no-encryption session over plain http")
+	}
+}
+
+func TestAssociateRejectsSessionTypeDowngrade(t *testing.T) {
+	srv := httptest.NewServer(associateHandler(t, map[string]string{
+		"assoc_handle": "h1",
+		"assoc_type":   requestedAssocType,
+		"session_type": "DH-SHA1",
+	}))
+	defer srv.Close()
+
+	c := &Client{AllowPrivateNetworks: true}
+	if _, err := c.Associate(context.Background(), srv.URL); err == nil {
+		t.Error("Associate accepted a session_type other than the one requested")
+	}
+}
+
+func TestAssociateRejectsAssocTypeDowngrade(t *testing.T) {
+	srv := httptest.NewServer(associateHandler(t, map[string]string{
+		"assoc_handle": "h1",
+		"assoc_type":   "HMAC-SHA1",
+		"session_type": requestedSessionType,
+	}))
+	defer srv.Close()
+
+	c := &Client{AllowPrivateNetworks: true}
+	if _, err := c.Associate(context.Background(), srv.URL); err == nil {
+		t.Error("Associate accepted an assoc_type other than the one requested")
+	}
+}
+
+func TestAssociateDHHandshake(t *testing.T) {
+	wantMACKey := []byte("0123456789012345678901234567890")
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		clientPubBytes, err := base64.StdEncoding.DecodeString(r.FormValue("openid.dh_consumer_public"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientPub := new(big.Int).SetBytes(clientPubBytes)
+
+		serverPriv, err := rand.Int(rand.Reader, defaultDHModulus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverPub := new(big.Int).Exp(defaultDHGenerator, serverPriv, defaultDHModulus)
+		shared := new(big.Int).Exp(clientPub, serverPriv, defaultDHModulus)
+		digest := sha256.Sum256(btwoc(shared))
+		encMACKey := xor(digest[:], wantMACKey)
+
+		kv := map[string]string{
+			"assoc_handle":     "handle-1",
+			"assoc_type":       requestedAssocType,
+			"session_type":     requestedSessionType,
+			"dh_server_public": base64.StdEncoding.EncodeToString(btwoc(serverPub)),
+			"enc_mac_key":      base64.StdEncoding.EncodeToString(encMACKey),
+			"expires_in":       "3600",
+		}
+		for k, v := range kv {
+			fmt.Fprintf(w, "%s:%s\n", k, v)
+		}
+	})
+
+	c := &Client{AllowPrivateNetworks: true}
+	assoc, err := c.Associate(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(assoc.MACKey) != string(wantMACKey) {
+		t.Errorf("MACKey = %q, want %q", assoc.MACKey, wantMACKey)
+	}
+	if got, ok := c.associationStore().Get(srv.URL); !ok || got.Handle != "handle-1" {
+		t.Errorf("association not stored under endpoint: got %v, ok=%v", got, ok)
+	}
+}
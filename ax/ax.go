@@ -0,0 +1,85 @@
+/*
+Package ax implements the OpenID Attribute Exchange 1.0 extension, letting a
+relying party ask an OP for attributes such as email or full name alongside
+the base OpenID assertion.
+*/
+package ax
+
+import (
+	"net/url"
+	"strings"
+)
+
+// NS is the Attribute Exchange 1.0 namespace URI.
+const NS = "http://openid.net/srv/ax/1.0"
+
+// Alias is the openid.ns.ax prefix Attribute Exchange parameters are
+// namespaced under.
+const Alias = "ax"
+
+// Common attribute type URIs, from the Attribute Exchange 1.0 schema
+// recommendations.
+const (
+	TypeEmail     = "http://axschema.org/contact/email"
+	TypeFirstName = "http://axschema.org/namePerson/first"
+	TypeLastName  = "http://axschema.org/namePerson/last"
+	TypeFullName  = "http://axschema.org/namePerson"
+	TypeNickname  = "http://axschema.org/namePerson/friendly"
+	TypeLanguage  = "http://axschema.org/pref/language"
+)
+
+// Request is an Attribute Exchange fetch request. Required and IfAvailable
+// map a caller-chosen alias to the attribute's type URI; the alias is used
+// to refer to the attribute in both the request and the response.
+type Request struct {
+	Required    map[string]string
+	IfAvailable map[string]string
+}
+
+// NamespaceURI implements openid.Extension.
+func (r Request) NamespaceURI() string { return NS }
+
+// Alias implements openid.Extension.
+func (r Request) Alias() string { return Alias }
+
+// AddRequest implements openid.Extension.
+func (r Request) AddRequest(v url.Values) {
+	v.Set("openid.ax.mode", "fetch_request")
+
+	var required, ifAvailable []string
+	for alias, typeURI := range r.Required {
+		v.Set("openid.ax.type."+alias, typeURI)
+		required = append(required, alias)
+	}
+	for alias, typeURI := range r.IfAvailable {
+		v.Set("openid.ax.type."+alias, typeURI)
+		ifAvailable = append(ifAvailable, alias)
+	}
+	if len(required) > 0 {
+		v.Set("openid.ax.required", strings.Join(required, ","))
+	}
+	if len(ifAvailable) > 0 {
+		v.Set("openid.ax.if_available", strings.Join(ifAvailable, ","))
+	}
+}
+
+// Response holds the attribute values an OP returned, keyed by the same
+// alias used in the Request.
+type Response map[string]string
+
+// ParseResponse implements openid.Extension. It returns a Response
+// containing whichever of the requested aliases the OP actually supplied.
+func (r Request) ParseResponse(v url.Values) (interface{}, error) {
+	out := make(Response)
+	for alias := range r.Required {
+		if val := v.Get("openid.ax.value." + alias); val != "" {
+			out[alias] = val
+		}
+	}
+	for alias := range r.IfAvailable {
+		if val := v.Get("openid.ax.value." + alias); val != "" {
+			out[alias] = val
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package ax
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRequestAddRequest(t *testing.T) {
+	r := Request{
+		Required:    map[string]string{"email": TypeEmail},
+		IfAvailable: map[string]string{"first": TypeFirstName},
+	}
+	v := url.Values{}
+	r.AddRequest(v)
+
+	if got := v.Get("openid.ax.mode"); got != "fetch_request" {
+		t.Errorf("ax.mode = %q, want fetch_request", got)
+	}
+	if got := v.Get("openid.ax.type.email"); got != TypeEmail {
+		t.Errorf("ax.type.email = %q, want %q", got, TypeEmail)
+	}
+	if got := v.Get("openid.ax.required"); got != "email" {
+		t.Errorf("ax.required = %q, want email", got)
+	}
+	if got := v.Get("openid.ax.if_available"); got != "first" {
+		t.Errorf("ax.if_available = %q, want first", got)
+	}
+}
+
+func TestRequestParseResponse(t *testing.T) {
+	r := Request{
+		Required:    map[string]string{"email": TypeEmail},
+		IfAvailable: map[string]string{"first": TypeFirstName},
+	}
+	v := url.Values{
+		"openid.ax.value.email": {"user@example.com"},
+	}
+
+	out, err := r.ParseResponse(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := out.(Response)
+	if !ok {
+		t.Fatalf("ParseResponse returned %T, want Response", out)
+	}
+	if resp["email"] != "user@example.com" {
+		t.Errorf("resp[email] = %q, want user@example.com", resp["email"])
+	}
+	if _, ok := resp["first"]; ok {
+		t.Error("resp[first] present despite the OP not supplying it")
+	}
+}
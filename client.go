@@ -0,0 +1,185 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Defaults used by a zero-value Client's unexported accessors, and by
+// NewClient.
+const (
+	DefaultUserAgent       = "go-openid"
+	DefaultMaxRedirects    = 5
+	DefaultMaxResponseSize = 1 << 20 // 1 MiB
+)
+
+// Client configures how this package talks to OpenID providers: the
+// underlying *http.Client, redirect and response-size limits, the
+// User-Agent sent with requests, and whether discovery may target private
+// networks. The zero value is ready to use, with the defaults above.
+type Client struct {
+	// HTTPClient performs requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// UserAgent is sent with every request. Defaults to DefaultUserAgent.
+	UserAgent string
+
+	// MaxRedirects bounds how many redirects a request will follow before
+	// giving up. Zero means DefaultMaxRedirects.
+	MaxRedirects int
+
+	// MaxResponseSize caps the number of bytes read from any single
+	// response body. Zero means DefaultMaxResponseSize.
+	MaxResponseSize int64
+
+	// AllowPrivateNetworks permits discovery and verification requests to
+	// target loopback, private or link-local addresses. It is false by
+	// default to guard against SSRF; enable it only in trusted test
+	// environments.
+	AllowPrivateNetworks bool
+
+	// NonceStore records openid.response_nonce values already validated,
+	// to reject replayed assertions. If nil, DefaultNonceStore is used.
+	NonceStore NonceStore
+
+	// AssociationStore caches Associations negotiated by Associate, keyed
+	// by OP endpoint, so that ValidateContext can verify a signature
+	// locally instead of round-tripping to the OP. If nil,
+	// DefaultAssociationStore is used.
+	AssociationStore AssociationStore
+
+	// ExpectedReturnTo must equal the openid.return_to value of every
+	// assertion this Client validates, closing the return_to substitution
+	// hole described in OpenID Authentication 2.0 section 11.1.
+	// ValidateContext refuses to validate anything until it is set; there
+	// is no safe default, since an empty check is equivalent to no check
+	// at all.
+	ExpectedReturnTo string
+}
+
+// DefaultClient is used by the package-level RedirectURI and Validate
+// functions.
+var DefaultClient = NewClient()
+
+// NewClient returns a Client configured with this package's defaults.
+func NewClient() *Client {
+	return &Client{}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+func (c *Client) maxRedirects() int {
+	if c.MaxRedirects != 0 {
+		return c.MaxRedirects
+	}
+	return DefaultMaxRedirects
+}
+
+func (c *Client) nonceStore() NonceStore {
+	if c.NonceStore != nil {
+		return c.NonceStore
+	}
+	return DefaultNonceStore
+}
+
+func (c *Client) associationStore() AssociationStore {
+	if c.AssociationStore != nil {
+		return c.AssociationStore
+	}
+	return DefaultAssociationStore
+}
+
+func (c *Client) maxResponseSize() int64 {
+	if c.MaxResponseSize != 0 {
+		return c.MaxResponseSize
+	}
+	return DefaultMaxResponseSize
+}
+
+// checkURL rejects identifiers and discovered endpoints that do not use
+// http(s), and - unless AllowPrivateNetworks is set - ones whose host
+// resolves to a loopback, private or link-local address, to guard against
+// SSRF. The host is resolved rather than just parsed as an IP literal, so a
+// hostname like "localhost" or an internal DNS name that resolves to a
+// private address is caught too.
+func (c *Client) checkURL(ctx context.Context, rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("openid: refusing non-http(s) URL " + rawurl)
+	}
+	if c.AllowPrivateNetworks {
+		return nil
+	}
+	host := u.Hostname()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("openid: could not resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if isPrivateNetwork(addr.IP) {
+			return fmt.Errorf("openid: refusing to contact private address %s (resolved from %s)", addr.IP, host)
+		}
+	}
+	return nil
+}
+
+func isPrivateNetwork(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// newRequest builds a GET or POST request carrying ctx and this Client's
+// User-Agent, after rejecting disallowed schemes and hosts.
+func (c *Client) newRequest(ctx context.Context, method, rawurl string, body io.Reader) (*http.Request, error) {
+	if err := c.checkURL(ctx, rawurl); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", c.userAgent())
+	return req, nil
+}
+
+// do performs req, capping the number of redirects followed at
+// c.maxRedirects() and re-running checkURL against each redirect's
+// destination - otherwise a redirect would bypass the SSRF guard newRequest
+// only applies to the initial URL.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	client := *c.httpClient()
+	max := c.maxRedirects()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= max {
+			return errors.New("openid: stopped after too many redirects")
+		}
+		return c.checkURL(req.Context(), req.URL.String())
+	}
+	return client.Do(req)
+}
+
+// readLimited reads up to c.maxResponseSize() bytes from r.
+func (c *Client) readLimited(r io.Reader) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r, c.maxResponseSize()))
+}
@@ -0,0 +1,69 @@
+package openid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckURLRejectsNonHTTP(t *testing.T) {
+	c := &Client{}
+	if err := c.checkURL(context.Background(), "ftp://example.com/"); err == nil {
+		t.Error("checkURL accepted a non-http(s) scheme")
+	}
+}
+
+func TestCheckURLRejectsPrivateIPLiteral(t *testing.T) {
+	c := &Client{}
+	if err := c.checkURL(context.Background(), "http://127.0.0.1/"); err == nil {
+		t.Error("checkURL accepted a loopback IP literal")
+	}
+}
+
+func TestCheckURLRejectsLocalhostHostname(t *testing.T) {
+	// "localhost" resolves to a loopback address but isn't an IP literal
+	// itself; checkURL must resolve it to catch this, not just parse it.
+	c := &Client{}
+	if err := c.checkURL(context.Background(), "http://localhost/"); err == nil {
+		t.Error("checkURL accepted the hostname \"localhost\"")
+	}
+}
+
+func TestCheckURLAllowsPrivateNetworksWhenOptedIn(t *testing.T) {
+	c := &Client{AllowPrivateNetworks: true}
+	if err := c.checkURL(context.Background(), "http://localhost/"); err != nil {
+		t.Errorf("checkURL rejected localhost with AllowPrivateNetworks set: %v", err)
+	}
+}
+
+func TestDoRevalidatesRedirectTarget(t *testing.T) {
+	// The initial request is built directly (bypassing newRequest's own
+	// checkURL call) so the test server's loopback address, which do()
+	// never checks itself, can't mask whether CheckRedirect re-validates
+	// the redirect's destination.
+	redirected := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			redirected = true
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := &Client{}
+	req, err := http.NewRequest("GET", srv.URL+"/redirect", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(context.Background())
+
+	if _, err := c.do(req); err == nil {
+		t.Fatal("do followed a redirect to a private address without re-checking it")
+	}
+	if !redirected {
+		t.Fatal("test server never issued the redirect")
+	}
+}
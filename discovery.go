@@ -0,0 +1,245 @@
+package openid
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Service types recognised during discovery. The "2.0" types come from
+// OpenID Authentication 2.0 section 7.3.1; the "1.0" types let discovery
+// still find older OPs that never upgraded their XRDS documents.
+const (
+	op2Type     = "http://specs.openid.net/auth/2.0/server"
+	signon2Type = "http://specs.openid.net/auth/2.0/signon"
+	op1Type     = "http://openid.net/server/1.0"
+	signon1Type = "http://openid.net/signon/1.0"
+)
+
+// DiscoveredEndpoint is the result of resolving an identifier to an OpenID
+// provider, per OpenID Authentication 2.0 section 7.
+type DiscoveredEndpoint struct {
+	OPEndpoint      string
+	ClaimedID       string
+	LocalID         string
+	ProtocolVersion string
+	Types           []string
+}
+
+// xrdsService is one <Service> entry of an XRDS document. Per the Yadis
+// specification, a lower Priority value is more preferred.
+type xrdsService struct {
+	Type     []string `xml:"Type"`
+	URI      []string `xml:"URI"`
+	LocalID  string   `xml:"LocalID"`
+	Priority uint     `xml:"priority,attr"`
+}
+
+type xrdsDocument struct {
+	XMLName xml.Name `xml:"XRDS"`
+	XRD     struct {
+		Service []xrdsService `xml:"Service"`
+	} `xml:"XRD"`
+}
+
+// Discover resolves identifier to the OP endpoint, and claimed/local
+// identifiers, to use for it. It performs a HEAD request first to look for
+// an X-XRDS-Location header (per the Yadis specification), falls back to a
+// GET for a native XRDS document or an X-XRDS-Location response header, and
+// as a last resort parses <link rel="openid2.provider"> and <link
+// rel="openid2.local_id"> out of an HTML document's <head>, per OpenID
+// Authentication 2.0 section 7.3.3.
+func (c *Client) Discover(ctx context.Context, identifier string) (*DiscoveredEndpoint, error) {
+	return c.discoverLocation(ctx, identifier, c.maxRedirects())
+}
+
+func (c *Client) discoverLocation(ctx context.Context, location string, redirectsLeft int) (*DiscoveredEndpoint, error) {
+	if redirectsLeft <= 0 {
+		return nil, errors.New("openid: stopped after too many discovery redirects")
+	}
+
+	if loc, err := c.yadisHeadLocation(ctx, location); err == nil && loc != "" && loc != location {
+		location = loc
+	}
+
+	req, err := c.newRequest(ctx, "GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", xrds_mime)
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The request that actually produced resp, after any HTTP redirects, is
+	// what identifier resolution settles on, per the Yadis specification
+	// section 6.2 - it's what a Claimed Identifier must be recorded as.
+	resolved := resp.Request.URL.String()
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, xrds_mime) {
+		body, err := c.readLimited(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		ep, err := parseXRDS(body)
+		if err != nil {
+			return nil, err
+		}
+		if hasType(ep.Types, signon2Type) || hasType(ep.Types, signon1Type) {
+			ep.ClaimedID = resolved
+		}
+		return ep, nil
+	}
+
+	if loc := resp.Header.Get("X-Xrds-Location"); loc != "" {
+		return c.discoverLocation(ctx, loc, redirectsLeft-1)
+	}
+
+	if strings.HasPrefix(contentType, "text/html") {
+		body, err := c.readLimited(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		html := string(body)
+		if loc, ok := yadisMetaLocation(html); ok {
+			return c.discoverLocation(ctx, loc, redirectsLeft-1)
+		}
+		if ep, ok := discoveredEndpointFromHTML(html); ok {
+			ep.ClaimedID = resolved
+			return ep, nil
+		}
+	}
+
+	return nil, errors.New("openid: could not discover an OpenID provider for " + location)
+}
+
+// yadisHeadLocation issues a HEAD request against location and returns the
+// X-XRDS-Location header, if the server advertises one. Servers that don't
+// support HEAD, or don't set the header, are not treated as an error: the
+// caller falls back to a plain GET.
+func (c *Client) yadisHeadLocation(ctx context.Context, location string) (string, error) {
+	req, err := c.newRequest(ctx, "HEAD", location, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("X-Xrds-Location"), nil
+}
+
+func parseXRDS(body []byte) (*DiscoveredEndpoint, error) {
+	var doc xrdsDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	services := doc.XRD.Service
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Priority < services[j].Priority
+	})
+
+	ep := &DiscoveredEndpoint{}
+	for _, svc := range services {
+		switch {
+		case hasType(svc.Type, op2Type), hasType(svc.Type, signon2Type):
+			ep.ProtocolVersion = "2.0"
+		case hasType(svc.Type, op1Type), hasType(svc.Type, signon1Type):
+			if ep.ProtocolVersion == "" {
+				ep.ProtocolVersion = "1.1"
+			}
+		default:
+			continue
+		}
+
+		if ep.OPEndpoint == "" && len(svc.URI) > 0 {
+			ep.OPEndpoint = svc.URI[0]
+			ep.Types = svc.Type
+			ep.LocalID = svc.LocalID
+			break
+		}
+	}
+
+	if ep.OPEndpoint == "" {
+		return nil, errors.New("openid: XRDS document had no recognised OpenID service")
+	}
+	return ep, nil
+}
+
+func hasType(types []string, want string) bool {
+	for _, t := range types {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+// The HTML fallback below only ever needs to pick out three specific tags -
+// a <meta http-equiv="X-XRDS-Location"> and the two <link> elements from
+// OpenID Authentication 2.0 section 7.3.3 - so a couple of targeted regular
+// expressions stand in for a full HTML parser, rather than pulling in a
+// dependency this package otherwise has none of.
+var (
+	metaXRDSTagRe     = regexp.MustCompile(`(?is)<meta\b[^>]*\bhttp-equiv\s*=\s*["']?X-XRDS-Location["']?[^>]*>`)
+	providerLinkTagRe = regexp.MustCompile(`(?is)<link\b[^>]*\brel\s*=\s*["']?openid2\.provider["']?[^>]*>`)
+	localIDLinkTagRe  = regexp.MustCompile(`(?is)<link\b[^>]*\brel\s*=\s*["']?openid2\.local_id["']?[^>]*>`)
+	htmlAttrRe        = regexp.MustCompile(`(?is)([\w-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// tagAttr returns the value of the named attribute from a single HTML start
+// tag, regardless of attribute order or quote style.
+func tagAttr(tag, name string) (string, bool) {
+	for _, m := range htmlAttrRe.FindAllStringSubmatch(tag, -1) {
+		if !strings.EqualFold(m[1], name) {
+			continue
+		}
+		if m[2] != "" {
+			return m[2], true
+		}
+		return m[3], true
+	}
+	return "", false
+}
+
+// yadisMetaLocation looks for the <meta http-equiv="X-XRDS-Location">
+// fallback defined by the Yadis specification for servers that cannot set
+// response headers.
+func yadisMetaLocation(html string) (string, bool) {
+	tag := metaXRDSTagRe.FindString(html)
+	if tag == "" {
+		return "", false
+	}
+	return tagAttr(tag, "content")
+}
+
+// discoveredEndpointFromHTML implements the HTML-based discovery fallback
+// of OpenID Authentication 2.0 section 7.3.3.
+func discoveredEndpointFromHTML(html string) (*DiscoveredEndpoint, bool) {
+	provider := providerLinkTagRe.FindString(html)
+	if provider == "" {
+		return nil, false
+	}
+	href, ok := tagAttr(provider, "href")
+	if !ok || href == "" {
+		return nil, false
+	}
+	ep := &DiscoveredEndpoint{
+		ProtocolVersion: "2.0",
+		OPEndpoint:      href,
+	}
+	if localID := localIDLinkTagRe.FindString(html); localID != "" {
+		if href, ok := tagAttr(localID, "href"); ok {
+			ep.LocalID = href
+		}
+	}
+	return ep, true
+}
@@ -0,0 +1,124 @@
+package openid
+
+import "testing"
+
+func TestHasType(t *testing.T) {
+	types := []string{op2Type, signon1Type}
+	if !hasType(types, op2Type) {
+		t.Error("hasType missed a present type")
+	}
+	if hasType(types, signon2Type) {
+		t.Error("hasType found an absent type")
+	}
+}
+
+func TestParseXRDSPrefersOP2Service(t *testing.T) {
+	doc := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Service priority="10">
+      <Type>http://openid.net/server/1.0</Type>
+      <URI>https://op.example/legacy</URI>
+    </Service>
+    <Service priority="0">
+      <Type>http://specs.openid.net/auth/2.0/signon</Type>
+      <URI>https://op.example/openid</URI>
+    </Service>
+  </XRD>
+</xrds:XRDS>`)
+
+	ep, err := parseXRDS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.OPEndpoint != "https://op.example/openid" {
+		t.Errorf("OPEndpoint = %q, want the lower-priority 2.0 signon service", ep.OPEndpoint)
+	}
+	if ep.ProtocolVersion != "2.0" {
+		t.Errorf("ProtocolVersion = %q, want 2.0", ep.ProtocolVersion)
+	}
+	// parseXRDS never sets ClaimedID itself: a signon-type Service's <URI>
+	// is the OP endpoint, not the identifier being discovered. It's
+	// discoverLocation's job to fill ClaimedID in with the identifier's own
+	// resolved location once it knows the Service was signon-type (see
+	// ep.Types below).
+	if ep.ClaimedID != "" {
+		t.Errorf("ClaimedID = %q, want empty; parseXRDS must not confuse the OP endpoint with the claimed identifier", ep.ClaimedID)
+	}
+	if !hasType(ep.Types, signon2Type) {
+		t.Errorf("Types = %v, want it to include %q so discoverLocation knows this is claimed-identifier discovery", ep.Types, signon2Type)
+	}
+}
+
+func TestParseXRDSOPIdentifierHasNoClaimedID(t *testing.T) {
+	doc := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Service priority="0">
+      <Type>http://specs.openid.net/auth/2.0/server</Type>
+      <URI>https://op.example/openid</URI>
+    </Service>
+  </XRD>
+</xrds:XRDS>`)
+
+	ep, err := parseXRDS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasType(ep.Types, signon2Type) || hasType(ep.Types, signon1Type) {
+		t.Errorf("Types = %v, an OP-directed service must not look like claimed-identifier discovery", ep.Types)
+	}
+}
+
+func TestYadisMetaLocation(t *testing.T) {
+	html := `<html><head><meta http-equiv="X-XRDS-Location" content="https://rp.example/yadis"></head></html>`
+	loc, ok := yadisMetaLocation(html)
+	if !ok || loc != "https://rp.example/yadis" {
+		t.Errorf("yadisMetaLocation = %q, %v, want https://rp.example/yadis, true", loc, ok)
+	}
+}
+
+func TestDiscoveredEndpointFromHTML(t *testing.T) {
+	html := `<html><head>
+<link rel="openid2.provider" href="https://op.example/openid">
+<link rel="openid2.local_id" href="https://op.example/users/alice">
+</head></html>`
+	ep, ok := discoveredEndpointFromHTML(html)
+	if !ok {
+		t.Fatal("discoveredEndpointFromHTML found nothing")
+	}
+	if ep.OPEndpoint != "https://op.example/openid" {
+		t.Errorf("OPEndpoint = %q, want https://op.example/openid", ep.OPEndpoint)
+	}
+	if ep.LocalID != "https://op.example/users/alice" {
+		t.Errorf("LocalID = %q, want https://op.example/users/alice", ep.LocalID)
+	}
+}
+
+func TestDiscoveredEndpointFromHTMLNoProvider(t *testing.T) {
+	if _, ok := discoveredEndpointFromHTML("<html><head></head></html>"); ok {
+		t.Error("discoveredEndpointFromHTML found a provider that isn't there")
+	}
+}
+
+func TestParseXRDSNoRecognisedService(t *testing.T) {
+	doc := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Service priority="0">
+      <Type>http://example.com/unrelated</Type>
+      <URI>https://op.example/unrelated</URI>
+    </Service>
+  </XRD>
+</xrds:XRDS>`)
+
+	if _, err := parseXRDS(doc); err == nil {
+		t.Error("parseXRDS accepted a document with no recognised OpenID service")
+	}
+}
+
+func TestParseXRDSMalformed(t *testing.T) {
+	if _, err := parseXRDS([]byte("not xml")); err == nil {
+		t.Error("parseXRDS accepted malformed XML")
+	}
+}
@@ -0,0 +1,48 @@
+package openid
+
+import "net/url"
+
+// Extension is implemented by OpenID 2.0 extensions - such as Attribute
+// Exchange (package ax) and Simple Registration (package sreg) - so that
+// RedirectURIContext and ValidateContext can request and parse extension
+// data alongside the base assertion.
+type Extension interface {
+	// NamespaceURI returns the XML namespace URI the extension is
+	// registered under, e.g. "http://openid.net/srv/ax/1.0".
+	NamespaceURI() string
+
+	// Alias returns the openid.ns.<alias> prefix this extension's
+	// parameters are namespaced under, e.g. "ax".
+	Alias() string
+
+	// AddRequest adds the extension's request parameters to v.
+	AddRequest(v url.Values)
+
+	// ParseResponse extracts the extension's data out of an assertion's
+	// values.
+	ParseResponse(v url.Values) (interface{}, error)
+}
+
+func addExtensions(v url.Values, extensions []Extension) {
+	for _, ext := range extensions {
+		v.Set("openid.ns."+ext.Alias(), ext.NamespaceURI())
+		ext.AddRequest(v)
+	}
+}
+
+// parseExtensions runs each extension's ParseResponse over values, keyed by
+// namespace URI. An extension that errors is omitted rather than failing
+// the whole assertion, since extension data is supplementary to the
+// identity assertion itself.
+func parseExtensions(values url.Values, extensions []Extension) map[string]interface{} {
+	if len(extensions) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(extensions))
+	for _, ext := range extensions {
+		if data, err := ext.ParseResponse(values); err == nil {
+			out[ext.NamespaceURI()] = data
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package openid
+
+import (
+	"container/list"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// NonceStore records which openid.response_nonce values have already been
+// seen for a given OP endpoint, so that Validate can reject replayed
+// assertions per OpenID Authentication 2.0 section 11.3. Implementations
+// must be safe for concurrent use.
+type NonceStore interface {
+	// Seen reports whether nonce has already been recorded for op, and
+	// records it if not.
+	Seen(op, nonce string, issued time.Time) (bool, error)
+}
+
+// NonceMaxAge bounds how long a nonce is tracked by a memoryNonceStore
+// before it is evicted. OPs are required to produce response_nonce values
+// with a current timestamp, so nothing legitimate needs to be remembered
+// for longer than this.
+const NonceMaxAge = 1 * time.Hour
+
+type nonceEntry struct {
+	key    string
+	issued time.Time
+}
+
+type memoryNonceStore struct {
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewMemoryNonceStore returns a NonceStore backed by an in-memory list kept
+// in insertion order. On each Seen call it drops entries from the front of
+// that list until it reaches one issued within NonceMaxAge; looking up a
+// nonce does not move its entry.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (s *memoryNonceStore) Seen(op, nonce string, issued time.Time) (bool, error) {
+	key := op + "\x00" + nonce
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictLocked()
+
+	if _, ok := s.entries[key]; ok {
+		return true, nil
+	}
+	s.entries[key] = s.order.PushBack(&nonceEntry{key: key, issued: issued})
+	return false, nil
+}
+
+func (s *memoryNonceStore) evictLocked() {
+	cutoff := time.Now().Add(-NonceMaxAge)
+	for e := s.order.Front(); e != nil; {
+		entry := e.Value.(*nonceEntry)
+		if entry.issued.After(cutoff) {
+			break
+		}
+		next := e.Next()
+		s.order.Remove(e)
+		delete(s.entries, entry.key)
+		e = next
+	}
+}
+
+// nonceTimestampLayout is the fixed-width Zulu timestamp OpenID
+// Authentication 2.0 section 11.3 requires at the front of a
+// response_nonce: always UTC, always "Z", never a numeric offset like
+// time.RFC3339 permits.
+const nonceTimestampLayout = "2006-01-02T15:04:05Z"
+
+// parseNonceIssued extracts the timestamp from the front of an
+// openid.response_nonce value, whose format is <timestamp><unique suffix>
+// per OpenID Authentication 2.0 section 11.3.
+func parseNonceIssued(nonce string) (time.Time, error) {
+	if len(nonce) < len(nonceTimestampLayout) {
+		return time.Time{}, errors.New("openid: malformed response_nonce")
+	}
+	return time.Parse(nonceTimestampLayout, nonce[:len(nonceTimestampLayout)])
+}
+
+// DefaultNonceStore is used by a Client whose NonceStore field is nil.
+var DefaultNonceStore NonceStore = NewMemoryNonceStore()
+
+// SQLNonceStore is a reference NonceStore backed by a SQL table with a
+// unique (op, nonce) key, e.g.:
+//
+//	CREATE TABLE openid_nonces (
+//		op     TEXT NOT NULL,
+//		nonce  TEXT NOT NULL,
+//		issued TIMESTAMP NOT NULL,
+//		PRIMARY KEY (op, nonce)
+//	);
+//
+// database/sql does not expose constraint violations in a driver-
+// independent way, so callers must supply IsDuplicateErr to recognise one
+// for their driver.
+type SQLNonceStore struct {
+	DB             *sql.DB
+	Table          string
+	IsDuplicateErr func(error) bool
+}
+
+// NewSQLNonceStore returns a SQLNonceStore using table (defaulting to
+// "openid_nonces") in db.
+func NewSQLNonceStore(db *sql.DB, table string, isDuplicateErr func(error) bool) *SQLNonceStore {
+	if table == "" {
+		table = "openid_nonces"
+	}
+	return &SQLNonceStore{DB: db, Table: table, IsDuplicateErr: isDuplicateErr}
+}
+
+func (s *SQLNonceStore) Seen(op, nonce string, issued time.Time) (bool, error) {
+	_, err := s.DB.Exec("INSERT INTO "+s.Table+" (op, nonce, issued) VALUES (?, ?, ?)", op, nonce, issued)
+	if err == nil {
+		return false, nil
+	}
+	if s.IsDuplicateErr != nil && s.IsDuplicateErr(err) {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,65 @@
+package openid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNonceIssued(t *testing.T) {
+	want := time.Date(2026, 7, 27, 12, 0, 0, 0, time.UTC)
+	for _, nonce := range []string{
+		"2026-07-27T12:00:00Zabc123",
+		"2026-07-27T12:00:00Z6f8e2b1d9c0a4f3e8b7d2c1a0f9e8d7c6b5a4938",
+	} {
+		got, err := parseNonceIssued(nonce)
+		if err != nil {
+			t.Fatalf("parseNonceIssued(%q): %v", nonce, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseNonceIssued(%q) = %v, want %v", nonce, got, want)
+		}
+	}
+}
+
+func TestParseNonceIssuedRejectsOffset(t *testing.T) {
+	// A numeric-offset timestamp is not valid per OpenID Authentication 2.0
+	// section 11.3, which mandates "Z" (UTC) nonces.
+	if _, err := parseNonceIssued("2026-07-27T12:00:00+01:00suffix"); err == nil {
+		t.Error("parseNonceIssued accepted a non-Zulu timestamp")
+	}
+}
+
+func TestParseNonceIssuedMalformed(t *testing.T) {
+	if _, err := parseNonceIssued("tooshort"); err == nil {
+		t.Error("parseNonceIssued accepted a nonce shorter than the timestamp")
+	}
+}
+
+func TestMemoryNonceStoreSeen(t *testing.T) {
+	s := NewMemoryNonceStore()
+	issued := time.Now()
+
+	seen, err := s.Seen("https://op.example", "n1", issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen {
+		t.Fatal("first use reported as already seen")
+	}
+
+	seen, err = s.Seen("https://op.example", "n1", issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seen {
+		t.Fatal("replayed nonce not detected")
+	}
+
+	seen, err = s.Seen("https://other.example", "n1", issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen {
+		t.Fatal("nonce scoped to one op reported seen for another")
+	}
+}
@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) (*rsa.PrivateKey, jwk) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, jwk{
+		Kty: "RSA",
+		Kid: "test-key",
+		Alg: "RS256",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(bigEndianUint(priv.PublicKey.E)),
+	}
+}
+
+func bigEndianUint(i int) []byte {
+	if i <= 0xFFFFFF {
+		return []byte{byte(i >> 16), byte(i >> 8), byte(i)}
+	}
+	return []byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)}
+}
+
+func signToken(t *testing.T, priv *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	priv, key := testKey(t)
+	c := &Client{ClientID: "client-1"}
+	c.config = ProviderConfig{Issuer: "https://op.example"}
+	c.keySet = &jwkSet{Keys: []jwk{key}}
+	c.keySetAge = time.Now()
+
+	raw := signToken(t, priv, key.Kid, map[string]interface{}{
+		"iss":   "https://op.example",
+		"sub":   "user-1",
+		"aud":   "client-1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": "n-123",
+	})
+
+	idToken, err := c.verifyIDToken(nil, raw, "n-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idToken.Subject != "user-1" {
+		t.Errorf("Subject = %q, want user-1", idToken.Subject)
+	}
+	if idToken.Issuer != "https://op.example" {
+		t.Errorf("Issuer = %q, want https://op.example", idToken.Issuer)
+	}
+}
+
+func TestVerifyIDTokenRejectsBadSignature(t *testing.T) {
+	priv, key := testKey(t)
+	_, otherKey := testKey(t)
+	otherKey.Kid = key.Kid // forged key material under the claimed kid
+
+	c := &Client{ClientID: "client-1"}
+	c.config = ProviderConfig{Issuer: "https://op.example"}
+	c.keySet = &jwkSet{Keys: []jwk{otherKey}}
+	c.keySetAge = time.Now()
+
+	raw := signToken(t, priv, key.Kid, map[string]interface{}{
+		"iss": "https://op.example",
+		"sub": "user-1",
+		"aud": "client-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	if _, err := c.verifyIDToken(nil, raw, ""); err == nil {
+		t.Error("verifyIDToken accepted a signature from an untrusted key")
+	}
+}
+
+func TestVerifyIDTokenRejectsIssuerMismatch(t *testing.T) {
+	priv, key := testKey(t)
+	c := &Client{ClientID: "client-1"}
+	c.config = ProviderConfig{Issuer: "https://op.example"}
+	c.keySet = &jwkSet{Keys: []jwk{key}}
+	c.keySetAge = time.Now()
+
+	raw := signToken(t, priv, key.Kid, map[string]interface{}{
+		"iss": "https://attacker.example",
+		"sub": "user-1",
+		"aud": "client-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	if _, err := c.verifyIDToken(nil, raw, ""); err == nil {
+		t.Error("verifyIDToken accepted a token from an unexpected issuer")
+	}
+}
+
+func TestVerifyIDTokenRejectsExpired(t *testing.T) {
+	priv, key := testKey(t)
+	c := &Client{ClientID: "client-1"}
+	c.config = ProviderConfig{Issuer: "https://op.example"}
+	c.keySet = &jwkSet{Keys: []jwk{key}}
+	c.keySetAge = time.Now()
+
+	raw := signToken(t, priv, key.Kid, map[string]interface{}{
+		"iss": "https://op.example",
+		"sub": "user-1",
+		"aud": "client-1",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+
+	if _, err := c.verifyIDToken(nil, raw, ""); err == nil {
+		t.Error("verifyIDToken accepted an expired token")
+	}
+}
+
+func TestVerifyIDTokenAcceptsArrayAudience(t *testing.T) {
+	priv, key := testKey(t)
+	c := &Client{ClientID: "client-1"}
+	c.config = ProviderConfig{Issuer: "https://op.example"}
+	c.keySet = &jwkSet{Keys: []jwk{key}}
+	c.keySetAge = time.Now()
+
+	raw := signToken(t, priv, key.Kid, map[string]interface{}{
+		"iss": "https://op.example",
+		"sub": "user-1",
+		"aud": []string{"other-client", "client-1"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	if _, err := c.verifyIDToken(nil, raw, ""); err != nil {
+		t.Fatalf("verifyIDToken rejected a token with a valid array aud: %v", err)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	c := &Client{ClientID: "client-1", RedirectURL: "https://rp.example/callback"}
+	c.config = ProviderConfig{AuthorizationEndpoint: "https://op.example/authorize"}
+
+	u := c.AuthCodeURL("state-1", "nonce-1", []string{"profile"})
+	if got, want := u, "https://op.example/authorize?client_id=client-1&nonce=nonce-1&redirect_uri=https%3A%2F%2Frp.example%2Fcallback&response_type=code&scope=openid+profile&state=state-1"; got != want {
+		t.Errorf("AuthCodeURL = %q, want %q", got, want)
+	}
+}
@@ -8,24 +8,24 @@ Example RedirectURI usage:
 
 Example Validate usage:
 
-	if ok, id, err := openid.Validate(r.URL.Query()); ok{
+	openid.DefaultClient.ExpectedReturnTo = "http://localhost/"
+	if ok, id, _, err := openid.Validate(r.URL.Query()); ok{
 		fmt.Println("id:", id)
 	}
 
+DefaultClient.ExpectedReturnTo (or a Client of your own) must be set
+before Validate will accept anything; see Client.ExpectedReturnTo.
+
 */
 package openid
 
 import (
 	"bytes"
-	"code.google.com/p/go-html-transform/h5"
-	"code.google.com/p/go-html-transform/html/transform"
-	"encoding/xml"
-	"errors"
-	"io"
-	"io/ioutil"
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 const (
@@ -33,21 +33,6 @@ const (
 	xrds_mime                 = "application/xrds+xml"
 )
 
-type xRDSIdentifier struct {
-	XMLName xml.Name "Service"
-	Type    []string
-	URI     string
-	LocalID string
-}
-type xRD struct {
-	XMLName xml.Name "XRD"
-	Service xRDSIdentifier
-}
-type xRDS struct {
-	XMLName xml.Name "XRDS"
-	XRD     xRD
-}
-
 func keyValueForm(corpus string) (o map[string]string) {
 	o = make(map[string]string)
 	for _, v := range strings.Split(corpus, "\n") {
@@ -67,8 +52,21 @@ Identifier represents the URI the user is claiming their openid is located at.
 Realm is a string that gives the user an indication of where the id will be used - 'http://example.com'.
 
 The openid provider returns the user to (realm + returnPoint) afterward.
+
+RedirectURI uses DefaultClient and context.Background(); to supply a
+deadline or cancellation, or a custom *http.Client, use
+DefaultClient.RedirectURIContext or a Client of your own.
+
+Any extensions (see the ax and sreg subpackages) are added to the request
+and should be passed again to Validate to parse the OP's response to them.
 */
-func RedirectURI(identifier, realm, returnPoint string) (string, error) {
+func RedirectURI(identifier, realm, returnPoint string, extensions ...Extension) (string, error) {
+	return DefaultClient.RedirectURIContext(context.Background(), identifier, realm, returnPoint, extensions...)
+}
+
+// RedirectURIContext is like RedirectURI, but performs discovery using c and
+// stops early if ctx is cancelled.
+func (c *Client) RedirectURIContext(ctx context.Context, identifier, realm, returnPoint string, extensions ...Extension) (string, error) {
 	//If the user's input starts with the "xri://" prefix, it MUST be stripped off, so that XRIs are used in the canonical form.
 	if strings.HasPrefix(identifier, "xri://") {
 		identifier = identifier[6:]
@@ -88,16 +86,12 @@ func RedirectURI(identifier, realm, returnPoint string) (string, error) {
 		identifier = identifier[index:]
 	}
 
-	rdClr, err := discover(identifier)
+	discovered, err := c.Discover(ctx, identifier)
 	if err != nil {
 		return "", err
 	}
 
-	endpoint, Claimed, err := getIdentifiers(rdClr)
-
-	if err != nil {
-		return "", err
-	}
+	endpoint, Claimed := discovered.OPEndpoint, discovered.ClaimedID
 	if Claimed == "" {
 		Claimed = "http://specs.openid.net/auth/2.0/identifier_select"
 	}
@@ -106,14 +100,23 @@ func RedirectURI(identifier, realm, returnPoint string) (string, error) {
 	} else {
 		endpoint = endpoint + "&"
 	}
-	return endpoint + url.Values(map[string][]string{
+	v := url.Values(map[string][]string{
 		"openid.claimed_id": {Claimed},
 		"openid.identity":   {Claimed},
 		"openid.realm":      {realm},
 		"openid.return_to":  {realm + returnPoint},
 		"openid.mode":       {"checkid_setup"},
 		"openid.ns":         {"http://specs.openid.net/auth/2.0"},
-	}).Encode(), nil
+	})
+	//If we already hold an Association for this OP endpoint (see
+	//Client.Associate), tell it which handle to sign with so
+	//ValidateContext can verify the response locally instead of
+	//round-tripping back to the OP.
+	if assoc, ok := c.associationStore().Get(discovered.OPEndpoint); ok {
+		v.Set("openid.assoc_handle", assoc.Handle)
+	}
+	addExtensions(v, extensions)
+	return endpoint + v.Encode(), nil
 }
 
 type validateError uint8
@@ -123,6 +126,11 @@ const (
 	DIFFERING_ENDPOINT
 	NS_INCORRECT
 	INCORRECT_MODE
+	RETURN_TO_MISMATCH
+	NONCE_REPLAYED
+	NO_EXPECTED_RETURN_TO
+	NO_RESPONSE_NONCE
+	MISSING_SIGNED_FIELD
 )
 
 func (v validateError) String() string {
@@ -135,6 +143,16 @@ func (v validateError) String() string {
 		return "ns in verification response was not 'http://specs.openid.net/auth/2.0'"
 	case INCORRECT_MODE:
 		return "Incorrect mode."
+	case RETURN_TO_MISMATCH:
+		return "openid.return_to did not match the expected return_to."
+	case NONCE_REPLAYED:
+		return "openid.response_nonce has already been used."
+	case NO_EXPECTED_RETURN_TO:
+		return "Client.ExpectedReturnTo must be set before ValidateContext can be used; the return_to substitution hole it closes (OpenID Authentication 2.0 section 11.1) cannot safely be left unchecked."
+	case NO_RESPONSE_NONCE:
+		return "openid.response_nonce is required and was not present in the assertion."
+	case MISSING_SIGNED_FIELD:
+		return "a required field, or a field belonging to a requested extension, was present but not listed in openid.signed."
 	}
 	return "Invalid error."
 }
@@ -145,8 +163,23 @@ func (v validateError) Error() string {
 /*
 Function Validate takes a url.Values and returns a bool which is true if the values argument represents an openid assertion that is true, as well
 as the user claimed ID.
+
+Validate uses DefaultClient and context.Background(); to supply a deadline
+or cancellation, or a custom *http.Client, use DefaultClient.ValidateContext
+or a Client of your own.
+
+Any extensions (see the ax and sreg subpackages) passed in must match those
+given to RedirectURI; their parsed responses are returned keyed by
+namespace URI.
 */
-func Validate(values url.Values) (grant bool, id string, err error) {
+func Validate(values url.Values, extensions ...Extension) (grant bool, id string, ext map[string]interface{}, err error) {
+	return DefaultClient.ValidateContext(context.Background(), values, extensions...)
+}
+
+// ValidateContext is like Validate, but performs the check_authentication
+// round-trip (when one is needed) using c and stops early if ctx is
+// cancelled.
+func (c *Client) ValidateContext(ctx context.Context, values url.Values, extensions ...Extension) (grant bool, id string, ext map[string]interface{}, err error) {
 	endpoint := values.Get("openid.op_endpoint")
 	if endpoint == "" {
 		err = NO_OP_ENDPOINT
@@ -157,108 +190,105 @@ func Validate(values url.Values) (grant bool, id string, err error) {
 		err = INCORRECT_MODE
 		return
 	}
-	values.Set("openid.mode", "check_authentication")
-	var resp *http.Response
-	resp, err = http.Post(endpoint, "application/x-www-form-urlencoded", bytes.NewBuffer([]byte(values.Encode())))
-
-	defer resp.Body.Close()
 
-	if err != nil {
+	if c.ExpectedReturnTo == "" {
+		err = NO_EXPECTED_RETURN_TO
 		return
 	}
-	var body []byte
-	body, err = ioutil.ReadAll(resp.Body)
-
-	if err != nil {
+	if values.Get("openid.return_to") != c.ExpectedReturnTo {
+		err = RETURN_TO_MISMATCH
 		return
 	}
 
-	kVs := keyValueForm(string(body))
-	if kVs["ns"] != "http://specs.openid.net/auth/2.0" {
-		err = NS_INCORRECT
+	nonce := values.Get("openid.response_nonce")
+	if nonce == "" {
+		err = NO_RESPONSE_NONCE
 		return
 	}
-
-	grant = kVs["is_valid"] == "true"
-	id = values.Get("openid.claimed_id")
-	return
-}
-
-func discover(identifier string) (io.ReadCloser, error) {
-	req, err := http.NewRequest("GET", identifier, nil)
+	var issued time.Time
+	issued, err = parseNonceIssued(nonce)
 	if err != nil {
-		return nil, err
+		return
 	}
-	req.Header.Add("Accept", xrds_mime)
-	resp, err := new(http.Client).Do(req)
+	var seen bool
+	seen, err = c.nonceStore().Seen(endpoint, nonce, issued)
 	if err != nil {
-		return nil, err
+		return
+	}
+	if seen {
+		err = NONCE_REPLAYED
+		return
 	}
 
-	//If we've got an XRDS document, we're okay, good.
-	if contentType := resp.Header.Get("Content-Type"); strings.HasPrefix(contentType, "application/xrds+xml") {
-		return resp.Body, nil
-		//Well, it might be in the header...
-	} else if h := resp.Header.Get("X-Xrds-Location"); h != "" {
-		return discover(h)
-		//If it's HTML we need to search the meta tags ;.;
-	} else if strings.HasPrefix(contentType, "text/html") {
-		p := h5.NewParser(resp.Body)
-		e := p.Parse()
-		if e != nil {
-			return nil, e
+	//Reject an assertion carrying a core or extension field that isn't
+	//listed in openid.signed: both the local-verification and
+	//check_authentication paths below only ever confirm the fields named
+	//in openid.signed actually came from the OP, so an unlisted field -
+	//a substituted claimed_id, or a forged ax/sreg value - would otherwise
+	//ride along unverified (OpenID Authentication 2.0 sections 10.1, 11.2).
+	if !verifyFieldsSigned(values, extensions) {
+		err = MISSING_SIGNED_FIELD
+		return
+	}
+
+	//Re-discover the claimed identifier's OP endpoint so a malicious OP
+	//cannot assert an identity it doesn't actually control (identifier
+	//substitution, OpenID Authentication 2.0 section 11.2).
+	if claimed := values.Get("openid.claimed_id"); claimed != "" {
+		var discovered *DiscoveredEndpoint
+		discovered, err = c.Discover(ctx, claimed)
+		if err != nil {
+			return
 		}
-		str, ok := discoverFromHTMLNode(p.Tree())
-		if ok {
-			return discover(str)
+		if discovered.OPEndpoint != endpoint {
+			err = DIFFERING_ENDPOINT
+			return
 		}
 	}
 
-	return resp.Body, errors.New("Could not locate Yadis document!")
-
-}
+	//If we have a cached association for this endpoint, verify the signature
+	//locally instead of round-tripping to the OP (OpenID 2.0 "smart mode").
+	if assoc, ok := c.associationStore().Get(endpoint); ok && values.Get("openid.assoc_handle") == assoc.Handle {
+		grant = assoc.verifySignature(values)
+		id = values.Get("openid.claimed_id")
+		if grant {
+			ext = parseExtensions(values, extensions)
+		}
+		return
+	}
 
-var yadisGetter = transform.NewSelectorQuery("meta[http-equiv=X-XRDS-Location]")
+	values.Set("openid.mode", "check_authentication")
+	var req *http.Request
+	req, err = c.newRequest(ctx, "POST", endpoint, bytes.NewBuffer([]byte(values.Encode())))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-func discoverFromHTMLNode(root *h5.Node) (loc string, ok bool) {
-	if r := yadisGetter.Apply(root); len(r) > 0 {
-		elm := r[0]
-		for _, v := range elm.Attr {
-			if v.Name == "content" {
-				return v.Value, true
-			}
-		}
+	var resp *http.Response
+	resp, err = c.do(req)
+	if err != nil {
+		return
 	}
-	return "", false
-}
+	defer resp.Body.Close()
 
-func getIdentifiers(xrds io.ReadCloser) (OP, Claimed string, e error) {
-	defer xrds.Close()
-	var xmlDoc []byte
-	xmlDoc, e = ioutil.ReadAll(xrds)
-	if e != nil {
+	var body []byte
+	body, err = c.readLimited(resp.Body)
+	if err != nil {
 		return
 	}
-	xrdsDocument := new(struct {
-		XMLName xml.Name "XRDS"
-		XRD     struct {
-			Service []struct {
-				Type     string
-				URI      string
-				Priority uint `xml:"priority,attr"`
-			}
-		}
-	})
 
-	xml.Unmarshal(xmlDoc, xrdsDocument)
-	for _, v := range xrdsDocument.XRD.Service {
-		if strings.HasPrefix(v.Type, "http://specs.openid.net/auth/2.0/server") {
-			OP = v.URI
-		} else if strings.HasPrefix(v.Type, "http://specs.openid.net/auth/2.0/signon") {
-			Claimed = v.URI
-		}
+	kVs := keyValueForm(string(body))
+	if kVs["ns"] != "http://specs.openid.net/auth/2.0" {
+		err = NS_INCORRECT
+		return
 	}
 
+	grant = kVs["is_valid"] == "true"
+	id = values.Get("openid.claimed_id")
+	if grant {
+		ext = parseExtensions(values, extensions)
+	}
 	return
 }
 
@@ -0,0 +1,67 @@
+package openid
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestValidateContextRequiresExpectedReturnTo(t *testing.T) {
+	c := &Client{}
+	values := url.Values{
+		"openid.op_endpoint": {"https://op.example/openid"},
+		"openid.mode":        {"id_res"},
+	}
+	_, _, _, err := c.ValidateContext(context.Background(), values)
+	if err != NO_EXPECTED_RETURN_TO {
+		t.Fatalf("ValidateContext with no ExpectedReturnTo set returned %v, want NO_EXPECTED_RETURN_TO", err)
+	}
+}
+
+func TestValidateContextReturnToMismatch(t *testing.T) {
+	c := &Client{ExpectedReturnTo: "https://rp.example/callback"}
+	values := url.Values{
+		"openid.op_endpoint": {"https://op.example/openid"},
+		"openid.mode":        {"id_res"},
+		"openid.return_to":   {"https://evil.example/callback"},
+	}
+	_, _, _, err := c.ValidateContext(context.Background(), values)
+	if err != RETURN_TO_MISMATCH {
+		t.Fatalf("ValidateContext with mismatched return_to returned %v, want RETURN_TO_MISMATCH", err)
+	}
+}
+
+func TestValidateContextRequiresClaimedIDSigned(t *testing.T) {
+	// claimed_id is present but missing from openid.signed: a shared OP
+	// endpoint serving many users could otherwise have this field swapped
+	// in after the fact while an unrelated, genuinely signed assertion's
+	// MAC (or check_authentication confirmation) still checks out.
+	c := &Client{ExpectedReturnTo: "https://rp.example/callback"}
+	values := url.Values{
+		"openid.op_endpoint":    {"https://op.example/openid"},
+		"openid.mode":           {"id_res"},
+		"openid.return_to":      {"https://rp.example/callback"},
+		"openid.response_nonce": {"2026-07-27T12:00:00Zabc123"},
+		"openid.claimed_id":     {"https://victim.example/"},
+		"openid.identity":       {"https://victim.example/"},
+		"openid.signed":         {"op_endpoint,return_to,response_nonce,assoc_handle,identity"},
+		"openid.assoc_handle":   {"handle-1"},
+	}
+	_, _, _, err := c.ValidateContext(context.Background(), values)
+	if err != MISSING_SIGNED_FIELD {
+		t.Fatalf("ValidateContext with unsigned claimed_id returned %v, want MISSING_SIGNED_FIELD", err)
+	}
+}
+
+func TestValidateContextRequiresResponseNonce(t *testing.T) {
+	c := &Client{ExpectedReturnTo: "https://rp.example/callback"}
+	values := url.Values{
+		"openid.op_endpoint": {"https://op.example/openid"},
+		"openid.mode":        {"id_res"},
+		"openid.return_to":   {"https://rp.example/callback"},
+	}
+	_, _, _, err := c.ValidateContext(context.Background(), values)
+	if err != NO_RESPONSE_NONCE {
+		t.Fatalf("ValidateContext with no openid.response_nonce returned %v, want NO_RESPONSE_NONCE", err)
+	}
+}
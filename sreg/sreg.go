@@ -0,0 +1,73 @@
+/*
+Package sreg implements the OpenID Simple Registration 1.1 extension,
+letting a relying party ask an OP for basic profile fields such as
+nickname, email and full name alongside the base OpenID assertion.
+*/
+package sreg
+
+import (
+	"net/url"
+	"strings"
+)
+
+// NS is the Simple Registration 1.1 namespace URI.
+const NS = "http://openid.net/extensions/sreg/1.1"
+
+// Alias is the openid.ns.sreg prefix Simple Registration parameters are
+// namespaced under.
+const Alias = "sreg"
+
+// Field names recognised by Simple Registration 1.1.
+const (
+	FieldNickname = "nickname"
+	FieldEmail    = "email"
+	FieldFullName = "fullname"
+	FieldDOB      = "dob"
+	FieldGender   = "gender"
+	FieldPostcode = "postcode"
+	FieldCountry  = "country"
+	FieldLanguage = "language"
+	FieldTimezone = "timezone"
+)
+
+// Request is a Simple Registration field request.
+type Request struct {
+	Required []string
+	Optional []string
+}
+
+// NamespaceURI implements openid.Extension.
+func (r Request) NamespaceURI() string { return NS }
+
+// Alias implements openid.Extension.
+func (r Request) Alias() string { return Alias }
+
+// AddRequest implements openid.Extension.
+func (r Request) AddRequest(v url.Values) {
+	if len(r.Required) > 0 {
+		v.Set("openid.sreg.required", strings.Join(r.Required, ","))
+	}
+	if len(r.Optional) > 0 {
+		v.Set("openid.sreg.optional", strings.Join(r.Optional, ","))
+	}
+}
+
+// Response holds the field values an OP returned, keyed by field name.
+type Response map[string]string
+
+// ParseResponse implements openid.Extension. It returns a Response
+// containing whichever of the requested fields the OP actually supplied.
+func (r Request) ParseResponse(v url.Values) (interface{}, error) {
+	out := make(Response)
+	for _, field := range r.Required {
+		if val := v.Get("openid.sreg." + field); val != "" {
+			out[field] = val
+		}
+	}
+	for _, field := range r.Optional {
+		if val := v.Get("openid.sreg." + field); val != "" {
+			out[field] = val
+		}
+	}
+	return out, nil
+}
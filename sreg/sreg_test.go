@@ -0,0 +1,47 @@
+package sreg
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRequestAddRequest(t *testing.T) {
+	r := Request{
+		Required: []string{FieldEmail},
+		Optional: []string{FieldNickname, FieldCountry},
+	}
+	v := url.Values{}
+	r.AddRequest(v)
+
+	if got := v.Get("openid.sreg.required"); got != FieldEmail {
+		t.Errorf("sreg.required = %q, want %q", got, FieldEmail)
+	}
+	if got := v.Get("openid.sreg.optional"); got != "nickname,country" {
+		t.Errorf("sreg.optional = %q, want nickname,country", got)
+	}
+}
+
+func TestRequestParseResponse(t *testing.T) {
+	r := Request{
+		Required: []string{FieldEmail},
+		Optional: []string{FieldNickname},
+	}
+	v := url.Values{
+		"openid.sreg.email": {"user@example.com"},
+	}
+
+	out, err := r.ParseResponse(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := out.(Response)
+	if !ok {
+		t.Fatalf("ParseResponse returned %T, want Response", out)
+	}
+	if resp[FieldEmail] != "user@example.com" {
+		t.Errorf("resp[email] = %q, want user@example.com", resp[FieldEmail])
+	}
+	if _, ok := resp[FieldNickname]; ok {
+		t.Error("resp[nickname] present despite the OP not supplying it")
+	}
+}